@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BatchRecord is one row of the batch summary: the outcome of scanning a
+// single target.
+type BatchRecord struct {
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	Proto  string `json:"protocol"`
+	LeafCN string `json:"leaf_cn"`
+	SANs   string `json:"sans"`
+	Issuer string `json:"issuer"`
+	Expiry string `json:"not_after"`
+	Error  string `json:"error,omitempty"`
+}
+
+// runBatch reads one target per line from targetsPath ("-" for stdin),
+// scans them concurrently, writes a per-host bundle for each into
+// config.OutputDir, and merges every distinct root/intermediate seen
+// across the whole run into roots.pem/intermediates.pem alongside a
+// summary of the scan.
+func runBatch(targetsPath string, config Config) error {
+	targets, err := readTargetLines(targetsPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(config.OutputDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output dir: %v", err)
+	}
+
+	concurrency := config.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	type job struct {
+		index  int
+		target string
+	}
+	jobs := make(chan job)
+	records := make([]BatchRecord, len(targets))
+
+	var mu sync.Mutex
+	seenRoots := make(map[[32]byte]*x509.Certificate)
+	seenIntermediates := make(map[[32]byte]*x509.Certificate)
+	usedBundleFiles := make(map[string]string) // bundle filename -> target that claimed it
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				records[j.index] = scanBatchTarget(j.target, config, &mu, seenRoots, seenIntermediates, usedBundleFiles)
+			}
+		}()
+	}
+
+	go func() {
+		for i, t := range targets {
+			jobs <- job{index: i, target: t}
+		}
+		close(jobs)
+	}()
+
+	wg.Wait()
+
+	if err := writeMergedPool(seenRoots, filepath.Join(config.OutputDir, "roots.pem")); err != nil {
+		return err
+	}
+	if err := writeMergedPool(seenIntermediates, filepath.Join(config.OutputDir, "intermediates.pem")); err != nil {
+		return err
+	}
+
+	return writeBatchSummary(records, config)
+}
+
+func scanBatchTarget(raw string, config Config, mu *sync.Mutex, roots, intermediates map[[32]byte]*x509.Certificate, usedBundleFiles map[string]string) BatchRecord {
+	target, err := parseTarget(raw)
+	if err != nil {
+		return BatchRecord{Host: raw, Error: err.Error()}
+	}
+
+	rec := BatchRecord{Host: target.bundleName(), Port: target.Port, Proto: target.Scheme}
+
+	provider, err := newProvider(target, config)
+	if err != nil {
+		rec.Error = err.Error()
+		return rec
+	}
+
+	certs, err := provider.Certificates()
+	if err != nil {
+		rec.Error = err.Error()
+		return rec
+	}
+	if len(certs) == 0 {
+		rec.Error = "no certificates found"
+		return rec
+	}
+
+	leaf := certs[0]
+	rec.LeafCN = leaf.Subject.CommonName
+	rec.SANs = strings.Join(leaf.DNSNames, ";")
+	rec.Issuer = leaf.Issuer.String()
+	rec.Expiry = leaf.NotAfter.Format("2006-01-02")
+
+	// Include scheme and port so distinct targets that share a bundleName()
+	// (e.g. smtp://mail.example.com and https://mail.example.com) get
+	// distinct files instead of racing on the same path.
+	bundleName := fmt.Sprintf("%s_%s_%s", rec.Host, rec.Proto, strconv.Itoa(rec.Port))
+	bundleFile := filepath.Join(config.OutputDir, bundleName+"_bundle.pem")
+
+	mu.Lock()
+	claimedBy, claimed := usedBundleFiles[bundleFile]
+	if !claimed {
+		usedBundleFiles[bundleFile] = raw
+	}
+	mu.Unlock()
+	if claimed {
+		rec.Error = fmt.Sprintf("skipped: output file %s already claimed by target %q", bundleFile, claimedBy)
+		return rec
+	}
+
+	if err := createCertificateBundle(certs, bundleFile, config.Verbose); err != nil {
+		rec.Error = err.Error()
+		return rec
+	}
+
+	mu.Lock()
+	for _, cert := range certs {
+		if !cert.IsCA {
+			continue
+		}
+		key := sha256.Sum256(cert.Raw)
+		if isSelfSigned(cert) {
+			roots[key] = cert
+		} else {
+			intermediates[key] = cert
+		}
+	}
+	mu.Unlock()
+
+	return rec
+}
+
+func readTargetLines(path string) ([]string, error) {
+	var r io.Reader
+	if path == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open targets file: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var targets []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	return targets, scanner.Err()
+}
+
+func writeMergedPool(certs map[[32]byte]*x509.Certificate, filename string) error {
+	if len(certs) == 0 {
+		return nil
+	}
+
+	list := make([]*x509.Certificate, 0, len(certs))
+	for _, c := range certs {
+		list = append(list, c)
+	}
+	return createCertificateBundle(list, filename, false)
+}
+
+func writeBatchSummary(records []BatchRecord, config Config) error {
+	if config.OutputFormat == "json" {
+		f, err := os.Create(filepath.Join(config.OutputDir, "summary.json"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+
+	f, err := os.Create(filepath.Join(config.OutputDir, "summary.csv"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	defer w.Flush()
+
+	if err := w.Write([]string{"host", "port", "protocol", "leaf_cn", "sans", "issuer", "not_after", "error"}); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := w.Write([]string{r.Host, fmt.Sprint(r.Port), r.Proto, r.LeafCN, r.SANs, r.Issuer, r.Expiry, r.Error}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
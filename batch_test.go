@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func selfSignedCA(t *testing.T, serial int64) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create cert: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse cert: %v", err)
+	}
+	return cert
+}
+
+// TestBatchRootDedupBySHA256 mirrors what scanBatchTarget does when it
+// records CA certificates seen across hosts: the same root fetched from
+// two different targets should collapse to one entry in the merged pool,
+// keyed by SHA-256 of the raw DER.
+func TestBatchRootDedupBySHA256(t *testing.T) {
+	rootA := selfSignedCA(t, 1)
+	rootB := selfSignedCA(t, 2)
+
+	var mu sync.Mutex
+	roots := make(map[[32]byte]*x509.Certificate)
+
+	record := func(cert *x509.Certificate) {
+		mu.Lock()
+		defer mu.Unlock()
+		roots[sha256.Sum256(cert.Raw)] = cert
+	}
+
+	// Simulate rootA showing up from three different hosts and rootB from
+	// one.
+	record(rootA)
+	record(rootA)
+	record(rootA)
+	record(rootB)
+
+	if len(roots) != 2 {
+		t.Fatalf("got %d deduplicated roots, want 2", len(roots))
+	}
+}
+
+func writeTestBundle(t *testing.T, dir string, cert *x509.Certificate) string {
+	t.Helper()
+
+	path := filepath.Join(dir, "source.pem")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create source bundle: %v", err)
+	}
+	defer f.Close()
+
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+		t.Fatalf("encode source bundle: %v", err)
+	}
+	return path
+}
+
+// TestScanBatchTargetDetectsBundleFileCollision exercises scanBatchTarget
+// directly: the same target listed twice (same bundleName/scheme/port)
+// must not silently let the second scan clobber the first's output file.
+func TestScanBatchTargetDetectsBundleFileCollision(t *testing.T) {
+	dir := t.TempDir()
+	sourcePath := writeTestBundle(t, dir, selfSignedCA(t, 99))
+	raw := "file://" + sourcePath
+
+	config := Config{OutputDir: dir}
+
+	var mu sync.Mutex
+	roots := make(map[[32]byte]*x509.Certificate)
+	intermediates := make(map[[32]byte]*x509.Certificate)
+	usedBundleFiles := make(map[string]string)
+
+	first := scanBatchTarget(raw, config, &mu, roots, intermediates, usedBundleFiles)
+	if first.Error != "" {
+		t.Fatalf("first scan failed: %s", first.Error)
+	}
+
+	second := scanBatchTarget(raw, config, &mu, roots, intermediates, usedBundleFiles)
+	if second.Error == "" {
+		t.Fatal("expected the second scan of the same target to report a bundle file collision")
+	}
+}
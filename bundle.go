@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+func createCertificateBundle(certs []*x509.Certificate, filename string, verbose bool) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for i, cert := range certs {
+		if verbose {
+			fmt.Printf("Adding certificate %d to bundle: %s\n", i+1, cert.Subject.CommonName)
+		}
+
+		block := &pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		}
+
+		if err := pem.Encode(file, block); err != nil {
+			return err
+		}
+
+		// Add newline between certificates
+		if i < len(certs)-1 {
+			file.Write([]byte("\n"))
+		}
+	}
+
+	fmt.Printf("Created certificate bundle: %s\n", filename)
+	fmt.Printf("Bundle contains %d certificate(s)\n", len(certs))
+
+	return nil
+}
+
+func createIndividualCertificates(certs []*x509.Certificate, verbose bool) error {
+	for i, cert := range certs {
+		filename := generateCertFilename(cert, i+1)
+
+		// Check if file already exists
+		if _, err := os.Stat(filename); err == nil {
+			if verbose {
+				fmt.Printf("Individual cert already exists: %s\n", filename)
+			}
+			continue
+		}
+
+		file, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+
+		block := &pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		}
+
+		err = pem.Encode(file, block)
+		file.Close()
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Saving individual cert: %s\n", filename)
+	}
+
+	return nil
+}
+
+func generateCertFilename(cert *x509.Certificate, index int) string {
+	// Try to use the common name
+	if cert.Subject.CommonName != "" {
+		name := sanitizeFilename(cert.Subject.CommonName)
+		return fmt.Sprintf("%s.crt", name)
+	}
+
+	// Try to use the first DNS name
+	if len(cert.DNSNames) > 0 {
+		name := sanitizeFilename(cert.DNSNames[0])
+		return fmt.Sprintf("%s.crt", name)
+	}
+
+	// Fall back to generic name
+	return fmt.Sprintf("cert_%d.crt", index)
+}
+
+func sanitizeFilename(name string) string {
+	// Remove or replace invalid filename characters
+	re := regexp.MustCompile(`[^a-zA-Z0-9\-\._]`)
+	cleaned := re.ReplaceAllString(name, "_")
+
+	// Remove leading wildcards
+	cleaned = strings.TrimPrefix(cleaned, "*.")
+
+	return cleaned
+}
+
+func printUsageInstructions(bundleFile, server string) {
+	fmt.Printf("\nUsage with curl:\n")
+	fmt.Printf("  curl --cacert %s https://%s/\n", bundleFile, server)
+	fmt.Printf("  curl --capath . https://%s/\n", server)
+	fmt.Printf("\nUsage with environment variables:\n")
+
+	absPath, _ := filepath.Abs(bundleFile)
+	fmt.Printf("  export SSL_CERT_FILE='%s'\n", absPath)
+	fmt.Printf("  export REQUESTS_CA_BUNDLE='%s'\n", absPath)
+	fmt.Printf("\nUsage with Go:\n")
+	fmt.Printf("  import \"crypto/x509\"\n")
+	fmt.Printf("  caCert, _ := ioutil.ReadFile(\"%s\")\n", bundleFile)
+	fmt.Printf("  caCertPool := x509.NewCertPool()\n")
+	fmt.Printf("  caCertPool.AppendCertsFromPEM(caCert)\n")
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// weakSignatureAlgorithms are signature algorithms considered broken or
+// on their way out; certificates signed with one of these are flagged in
+// check reports regardless of expiry.
+var weakSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+	x509.MD2WithRSA:    true,
+	x509.MD5WithRSA:    true,
+	x509.SHA1WithRSA:   true,
+	x509.DSAWithSHA1:   true,
+	x509.DSAWithSHA256: true,
+	x509.ECDSAWithSHA1: true,
+}
+
+// CertReport is the per-certificate result of a -check run.
+type CertReport struct {
+	Subject          string   `json:"subject"`
+	Issuer           string   `json:"issuer"`
+	NotAfter         string   `json:"not_after"`
+	DaysUntilExpiry  int      `json:"days_until_expiry"`
+	Expired          bool     `json:"expired"`
+	ExpiringSoon     bool     `json:"expiring_soon"`
+	SignatureAlg     string   `json:"signature_algorithm"`
+	WeakSignature    bool     `json:"weak_signature"`
+	KeySizeBits      int      `json:"key_size_bits"`
+	SelfSigned       bool     `json:"self_signed"`
+	SANs             []string `json:"sans,omitempty"`
+	MatchesHostname  *bool    `json:"matches_hostname,omitempty"`
+	ChainVerified    bool     `json:"chain_verified"`
+	ChainError       string   `json:"chain_error,omitempty"`
+	RevocationStatus string   `json:"revocation_status"`
+	RevocationError  string   `json:"revocation_error,omitempty"`
+}
+
+// CheckReport is the full result of a -check run across a chain.
+type CheckReport struct {
+	Target       string       `json:"target"`
+	Certificates []CertReport `json:"certificates"`
+	OK           bool         `json:"ok"`
+}
+
+// runCheck fetches no certificates itself; it inspects an already-fetched
+// chain and either prints a text or JSON report, returning a non-nil
+// error (so main exits non-zero) when any certificate is expired, within
+// warnDays of expiring, or revoked.
+func runCheck(hostname string, certs []*x509.Certificate, config Config) error {
+	report := CheckReport{Target: hostname, OK: true}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	for i, cert := range certs {
+		cr := buildCertReport(cert, certs, i, hostname, intermediates, config.WarnDays)
+		if cr.Expired || cr.ExpiringSoon || cr.RevocationStatus == "revoked" {
+			report.OK = false
+		}
+		report.Certificates = append(report.Certificates, cr)
+	}
+
+	if err := printCheckReport(report, config.OutputFormat); err != nil {
+		return err
+	}
+
+	if !report.OK {
+		return fmt.Errorf("one or more certificates failed validation checks")
+	}
+	return nil
+}
+
+func buildCertReport(cert *x509.Certificate, chain []*x509.Certificate, index int, hostname string, intermediates *x509.CertPool, warnDays int) CertReport {
+	now := time.Now()
+	daysLeft := int(cert.NotAfter.Sub(now).Hours() / 24)
+
+	cr := CertReport{
+		Subject:         cert.Subject.String(),
+		Issuer:          cert.Issuer.String(),
+		NotAfter:        cert.NotAfter.Format(time.RFC3339),
+		DaysUntilExpiry: daysLeft,
+		Expired:         now.After(cert.NotAfter),
+		ExpiringSoon:    daysLeft >= 0 && daysLeft <= warnDays,
+		SignatureAlg:    cert.SignatureAlgorithm.String(),
+		WeakSignature:   weakSignatureAlgorithms[cert.SignatureAlgorithm],
+		KeySizeBits:     publicKeyBits(cert),
+		SelfSigned:      isSelfSigned(cert),
+		SANs:            cert.DNSNames,
+	}
+
+	if index == 0 && hostname != "" {
+		matches := cert.VerifyHostname(hostname) == nil
+		cr.MatchesHostname = &matches
+	}
+
+	if index == 0 {
+		opts := x509.VerifyOptions{Intermediates: intermediates}
+		if _, err := cert.Verify(opts); err != nil {
+			cr.ChainError = err.Error()
+		} else {
+			cr.ChainVerified = true
+		}
+	}
+
+	status, err := checkRevocation(cert, chain, index)
+	cr.RevocationStatus = status
+	if err != nil {
+		cr.RevocationError = err.Error()
+	}
+
+	return cr
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	if cert.Subject.String() != cert.Issuer.String() {
+		return false
+	}
+	return cert.CheckSignatureFrom(cert) == nil
+}
+
+func publicKeyBits(cert *x509.Certificate) int {
+	switch pub := cert.PublicKey.(type) {
+	case interface{ BitLen() int }: // *rsa.PublicKey implements this
+		return pub.BitLen()
+	default:
+		return 0
+	}
+}
+
+// checkRevocation consults OCSP first (via the issuer, which is the next
+// certificate up the chain) and falls back to the leaf's CRL
+// distribution points. Self-signed roots have no issuer to check against
+// and are reported as "unknown".
+func checkRevocation(cert *x509.Certificate, chain []*x509.Certificate, index int) (string, error) {
+	if index+1 >= len(chain) {
+		return "unknown", nil
+	}
+	issuer := chain[index+1]
+
+	if len(cert.OCSPServer) > 0 {
+		status, err := checkOCSP(cert, issuer)
+		if err == nil {
+			return status, nil
+		}
+		// Fall through to CRL on OCSP failure.
+	}
+
+	if len(cert.CRLDistributionPoints) > 0 {
+		return checkCRL(cert, issuer)
+	}
+
+	return "unknown", nil
+}
+
+func checkOCSP(cert, issuer *x509.Certificate) (string, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return "unknown", err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	httpResp, err := client.Post(cert.OCSPServer[0], "application/ocsp-request", strings.NewReader(string(req)))
+	if err != nil {
+		return "unknown", err
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return "unknown", err
+	}
+
+	resp, err := ocsp.ParseResponse(body, issuer)
+	if err != nil {
+		return "unknown", err
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		return "good", nil
+	case ocsp.Revoked:
+		return "revoked", nil
+	default:
+		return "unknown", nil
+	}
+}
+
+// checkCRL fetches the leaf's CRL and checks its serial against the
+// revoked list, but only after verifying the CRL is actually signed by
+// issuer — most CRLDistributionPoints are plain http://, so an
+// unauthenticated fetch is trivially spoofable into a forged "nothing is
+// revoked" response otherwise.
+func checkCRL(cert, issuer *x509.Certificate) (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(cert.CRLDistributionPoints[0])
+	if err != nil {
+		return "unknown", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "unknown", err
+	}
+
+	crl, err := x509.ParseCRL(body)
+	if err != nil {
+		return "unknown", err
+	}
+
+	if err := issuer.CheckCRLSignature(crl); err != nil {
+		return "unknown", fmt.Errorf("CRL signature verification failed: %v", err)
+	}
+
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return "revoked", nil
+		}
+	}
+	return "good", nil
+}
+
+func printCheckReport(report CheckReport, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	for _, cr := range report.Certificates {
+		fmt.Printf("Subject: %s\n", cr.Subject)
+		fmt.Printf("  Issuer:              %s\n", cr.Issuer)
+		fmt.Printf("  Not after:           %s (%d days)\n", cr.NotAfter, cr.DaysUntilExpiry)
+		if cr.Expired {
+			fmt.Printf("  ** EXPIRED **\n")
+		} else if cr.ExpiringSoon {
+			fmt.Printf("  ** EXPIRES SOON **\n")
+		}
+		fmt.Printf("  Signature algorithm: %s", cr.SignatureAlg)
+		if cr.WeakSignature {
+			fmt.Printf(" (weak)")
+		}
+		fmt.Printf("\n")
+		fmt.Printf("  Key size:            %d bits\n", cr.KeySizeBits)
+		fmt.Printf("  Self-signed:         %v\n", cr.SelfSigned)
+		if cr.MatchesHostname != nil {
+			fmt.Printf("  Matches hostname:    %v\n", *cr.MatchesHostname)
+		}
+		if len(cr.SANs) > 0 {
+			fmt.Printf("  SANs:                %s\n", strings.Join(cr.SANs, ", "))
+		}
+		fmt.Printf("  Chain verified:      %v\n", cr.ChainVerified)
+		if cr.ChainError != "" {
+			fmt.Printf("  Chain error:         %s\n", cr.ChainError)
+		}
+		fmt.Printf("  Revocation status:   %s\n", cr.RevocationStatus)
+		if cr.RevocationError != "" {
+			fmt.Printf("  Revocation error:    %s\n", cr.RevocationError)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// issueTestChain builds a minimal self-signed CA and a leaf certificate it
+// signs, with OCSPServer/CRLDistributionPoints pointed at the given URLs,
+// for exercising checkRevocation without a live network.
+func issueTestChain(t *testing.T, ocspURL, crlURL string) (leaf, ca *x509.Certificate, caKey *ecdsa.PrivateKey) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create CA cert: %v", err)
+	}
+	ca, err = x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("parse CA cert: %v", err)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate leaf key: %v", err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "leaf.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if ocspURL != "" {
+		leafTemplate.OCSPServer = []string{ocspURL}
+	}
+	if crlURL != "" {
+		leafTemplate.CRLDistributionPoints = []string{crlURL}
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create leaf cert: %v", err)
+	}
+	leaf, err = x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatalf("parse leaf cert: %v", err)
+	}
+
+	return leaf, ca, caKey
+}
+
+func TestCheckRevocationNoEndpointsIsUnknown(t *testing.T) {
+	leaf, ca, _ := issueTestChain(t, "", "")
+
+	status, err := checkRevocation(leaf, []*x509.Certificate{leaf, ca}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status != "unknown" {
+		t.Fatalf("status = %q, want unknown", status)
+	}
+}
+
+func TestCheckRevocationFallsBackToCRLWhenOCSPFails(t *testing.T) {
+	// A broken OCSP responder forces checkRevocation to fall back to CRL.
+	ocspSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ocspSrv.Close()
+
+	crlMux := http.NewServeMux()
+	crlSrv := httptest.NewServer(crlMux)
+	defer crlSrv.Close()
+
+	leaf, ca, caKey := issueTestChain(t, ocspSrv.URL, crlSrv.URL)
+
+	crlMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		crlBytes, err := ca.CreateCRL(rand.Reader, caKey, []pkix.RevokedCertificate{
+			{SerialNumber: leaf.SerialNumber, RevocationTime: time.Now()},
+		}, time.Now(), time.Now().Add(time.Hour))
+		if err != nil {
+			t.Errorf("create CRL: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(crlBytes)
+	})
+
+	status, err := checkRevocation(leaf, []*x509.Certificate{leaf, ca}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status != "revoked" {
+		t.Fatalf("status = %q, want revoked", status)
+	}
+}
+
+func TestCheckCRLRejectsForgedCRL(t *testing.T) {
+	// A CRL signed by an unrelated key (as an interceptor of a plaintext
+	// http:// CRLDistributionPoint fetch could forge) must not be trusted,
+	// even if it claims the leaf is not revoked.
+	leaf, ca, _ := issueTestChain(t, "", "")
+
+	forgerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate forger key: %v", err)
+	}
+	forgedCRL, err := ca.CreateCRL(rand.Reader, forgerKey, nil, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("create forged CRL: %v", err)
+	}
+
+	crlSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(forgedCRL)
+	}))
+	defer crlSrv.Close()
+	leaf.CRLDistributionPoints = []string{crlSrv.URL}
+
+	status, err := checkCRL(leaf, ca)
+	if err == nil {
+		t.Fatal("expected a signature verification error for a forged CRL")
+	}
+	if status != "unknown" {
+		t.Fatalf("status = %q, want unknown", status)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+)
+
+// Provider knows how to obtain a certificate chain from a single source,
+// whether that source is a live network endpoint or a file on disk.
+type Provider interface {
+	Certificates() ([]*x509.Certificate, error)
+}
+
+// newProvider selects a Provider implementation for the given target based
+// on its scheme. Unknown schemes fall back to a plain TLS connection, same
+// as the original extractCertificates default.
+func newProvider(target Target, config Config) (Provider, error) {
+	switch target.Scheme {
+	case "https", "tls":
+		return &tlsProvider{target: target, config: config}, nil
+	case "smtp", "imap", "pop3", "ftp", "xmpp", "ldap", "mysql", "postgres":
+		return &starttlsProvider{target: target, config: config}, nil
+	case "file":
+		if target.Path == "" {
+			return nil, fmt.Errorf("file:// target requires a path")
+		}
+		return &fileProvider{path: target.Path}, nil
+	case "pkcs12":
+		if target.Path == "" {
+			return nil, fmt.Errorf("pkcs12:// target requires a path")
+		}
+		return &pkcs12Provider{path: target.Path, password: config.pkcs12Password()}, nil
+	default:
+		return &tlsProvider{target: target, config: config}, nil
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// fileProvider reads a PEM bundle from disk and returns every CERTIFICATE
+// block it contains, in file order. This lets the tool also double as a
+// generic PEM bundle inspector, not just a network extractor.
+type fileProvider struct {
+	path string
+}
+
+func (p *fileProvider) Certificates() ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", p.path, err)
+	}
+
+	var certs []*x509.Certificate
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in %s: %v", p.path, err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no CERTIFICATE blocks found in %s", p.path)
+	}
+
+	return certs, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func writeTestCert(t *testing.T, f *os.File, cert *x509.Certificate) {
+	t.Helper()
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+		t.Fatalf("encode cert: %v", err)
+	}
+}
+
+func TestFileProviderParsesMultipleCertificates(t *testing.T) {
+	leaf := selfSignedCA(t, 1)
+	root := selfSignedCA(t, 2)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bundle.pem")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create bundle: %v", err)
+	}
+	writeTestCert(t, f, leaf)
+	// A non-CERTIFICATE block in between should be skipped, not parsed.
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: []byte("not a cert")}); err != nil {
+		t.Fatalf("encode private key block: %v", err)
+	}
+	writeTestCert(t, f, root)
+	if err := f.Close(); err != nil {
+		t.Fatalf("close bundle: %v", err)
+	}
+
+	p := &fileProvider{path: path}
+	certs, err := p.Certificates()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("got %d certs, want 2", len(certs))
+	}
+	if certs[0].SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		t.Errorf("certs[0] serial = %v, want %v", certs[0].SerialNumber, leaf.SerialNumber)
+	}
+	if certs[1].SerialNumber.Cmp(root.SerialNumber) != 0 {
+		t.Errorf("certs[1] serial = %v, want %v", certs[1].SerialNumber, root.SerialNumber)
+	}
+}
+
+func TestFileProviderNoCertificateBlocksIsError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(path, []byte("not pem at all"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	p := &fileProvider{path: path}
+	if _, err := p.Certificates(); err == nil {
+		t.Fatal("expected error for bundle with no CERTIFICATE blocks, got nil")
+	}
+}
+
+func TestFileProviderMissingFileIsError(t *testing.T) {
+	p := &fileProvider{path: filepath.Join(t.TempDir(), "does-not-exist.pem")}
+	if _, err := p.Certificates(); err == nil {
+		t.Fatal("expected error for missing file, got nil")
+	}
+}
+
+func TestFileProviderBadCertificateIsError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bad.pem")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")}); err != nil {
+		t.Fatalf("encode block: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("close file: %v", err)
+	}
+
+	p := &fileProvider{path: path}
+	if _, err := p.Certificates(); err == nil {
+		t.Fatal("expected parse error for malformed certificate, got nil")
+	}
+}
+
+// leafSignedBy issues a leaf certificate under ca, signed with caKey, and
+// returns both the certificate and its own private key so callers can
+// build a PKCS#12 store around it.
+func leafSignedBy(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, serial int64, cn string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate leaf key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create leaf cert: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse leaf cert: %v", err)
+	}
+	return leaf, leafKey
+}
+
+func TestPkcs12ProviderDecodesChain(t *testing.T) {
+	_, ca, caKey := issueTestChain(t, "", "")
+	leaf, leafKey := leafSignedBy(t, ca, caKey, 42, "leaf.example.com")
+
+	pfxData, err := pkcs12.Modern.Encode(leafKey, leaf, []*x509.Certificate{ca}, "hunter2")
+	if err != nil {
+		t.Fatalf("encode pkcs12 store: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "client.p12")
+	if err := os.WriteFile(path, pfxData, 0o600); err != nil {
+		t.Fatalf("write p12 file: %v", err)
+	}
+
+	p := &pkcs12Provider{path: path, password: "hunter2"}
+	certs, err := p.Certificates()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("got %d certs, want 2 (leaf + ca)", len(certs))
+	}
+	if certs[0].SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		t.Errorf("certs[0] serial = %v, want leaf serial %v", certs[0].SerialNumber, leaf.SerialNumber)
+	}
+	if certs[1].SerialNumber.Cmp(ca.SerialNumber) != 0 {
+		t.Errorf("certs[1] serial = %v, want ca serial %v", certs[1].SerialNumber, ca.SerialNumber)
+	}
+}
+
+func TestPkcs12ProviderWrongPasswordIsError(t *testing.T) {
+	_, ca, caKey := issueTestChain(t, "", "")
+	leaf, leafKey := leafSignedBy(t, ca, caKey, 43, "leaf2.example.com")
+
+	pfxData, err := pkcs12.Modern.Encode(leafKey, leaf, nil, "correct-password")
+	if err != nil {
+		t.Fatalf("encode pkcs12 store: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "client.p12")
+	if err := os.WriteFile(path, pfxData, 0o600); err != nil {
+		t.Fatalf("write p12 file: %v", err)
+	}
+
+	p := &pkcs12Provider{path: path, password: "wrong-password"}
+	if _, err := p.Certificates(); err == nil {
+		t.Fatal("expected error for wrong password, got nil")
+	}
+}
+
+func TestNewProviderDispatchesFileAndPkcs12(t *testing.T) {
+	config := Config{}
+
+	p, err := newProvider(Target{Scheme: "file", Path: "/tmp/bundle.pem"}, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := p.(*fileProvider); !ok {
+		t.Errorf("got %T, want *fileProvider", p)
+	}
+
+	p, err = newProvider(Target{Scheme: "pkcs12", Path: "/tmp/client.p12"}, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := p.(*pkcs12Provider); !ok {
+		t.Errorf("got %T, want *pkcs12Provider", p)
+	}
+
+	if _, err := newProvider(Target{Scheme: "file", Path: ""}, config); err == nil {
+		t.Error("expected error for file:// target with no path, got nil")
+	}
+	if _, err := newProvider(Target{Scheme: "pkcs12", Path: ""}, config); err == nil {
+		t.Error("expected error for pkcs12:// target with no path, got nil")
+	}
+}
+
+func TestParseTargetFileAndPkcs12Paths(t *testing.T) {
+	tgt, err := parseTarget("file:///etc/ssl/certs/bundle.pem")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tgt.Scheme != "file" {
+		t.Errorf("Scheme = %q, want %q", tgt.Scheme, "file")
+	}
+	if tgt.Path != "/etc/ssl/certs/bundle.pem" {
+		t.Errorf("Path = %q, want %q", tgt.Path, "/etc/ssl/certs/bundle.pem")
+	}
+	if tgt.Server != "" {
+		t.Errorf("Server = %q, want empty", tgt.Server)
+	}
+
+	tgt, err = parseTarget("pkcs12:///etc/ssl/client.p12")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tgt.Scheme != "pkcs12" {
+		t.Errorf("Scheme = %q, want %q", tgt.Scheme, "pkcs12")
+	}
+	if tgt.Path != "/etc/ssl/client.p12" {
+		t.Errorf("Path = %q, want %q", tgt.Path, "/etc/ssl/client.p12")
+	}
+
+	if got := tgt.bundleName(); got != "client" {
+		t.Errorf("bundleName() = %q, want %q", got, "client")
+	}
+}
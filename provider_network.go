@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+// tlsProvider fetches the peer certificate chain from a direct TLS
+// handshake, used for the "https" and "tls" schemes.
+type tlsProvider struct {
+	target Target
+	config Config
+}
+
+func (p *tlsProvider) Certificates() ([]*x509.Certificate, error) {
+	return getTLSCertificates(p.target.Server, p.target.Port, p.config)
+}
+
+// starttlsProvider fetches the peer certificate chain after upgrading a
+// plaintext connection via STARTTLS, used for "smtp", "imap" and "pop3".
+type starttlsProvider struct {
+	target Target
+	config Config
+}
+
+func (p *starttlsProvider) Certificates() ([]*x509.Certificate, error) {
+	if p.target.Scheme == "smtp" {
+		// Probe with the standard library client first; some servers are
+		// picky about seeing a well-formed SMTP session before STARTTLS.
+		if err := probeSMTP(p.target.Server, p.target.Port, p.config); err != nil {
+			return nil, err
+		}
+	}
+	return getTLSCertificatesWithSTARTTLS(p.target.Server, p.target.Port, p.target.Scheme, p.config)
+}
+
+// probeSMTP performs a throwaway SMTP session using net/smtp purely to
+// fail fast if the server doesn't speak SMTP at all.
+func probeSMTP(server string, port int, config Config) error {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", server, port), config.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client, err := smtp.NewClient(conn, server)
+	if err != nil {
+		return err
+	}
+	defer client.Quit()
+
+	tlsConfig, err := buildTLSConfig(server, config)
+	if err != nil {
+		return err
+	}
+	return client.StartTLS(tlsConfig)
+}
+
+func getTLSCertificates(server string, port int, config Config) ([]*x509.Certificate, error) {
+	tlsConfig, err := buildTLSConfig(server, config)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := tls.DialWithDialer(
+		&net.Dialer{Timeout: config.Timeout},
+		"tcp",
+		fmt.Sprintf("%s:%d", server, port),
+		tlsConfig,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	return state.PeerCertificates, nil
+}
+
+// getTLSCertificatesWithSTARTTLS lives in starttls.go, driven by a
+// ProbeScript rather than hard-coded per-protocol logic.
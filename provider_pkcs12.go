@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// pkcs12Provider decrypts a .p12/.pfx store from disk and returns its
+// certificate chain (the leaf plus any CA certificates bundled alongside
+// it).
+type pkcs12Provider struct {
+	path     string
+	password string
+}
+
+func (p *pkcs12Provider) Certificates() ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", p.path, err)
+	}
+
+	_, cert, caCerts, err := pkcs12.DecodeChain(data, p.password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode pkcs12 store %s: %v", p.path, err)
+	}
+
+	certs := make([]*x509.Certificate, 0, 1+len(caCerts))
+	if cert != nil {
+		certs = append(certs, cert)
+	}
+	certs = append(certs, caCerts...)
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", p.path)
+	}
+
+	return certs, nil
+}
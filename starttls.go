@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProbeStep is a single exchange in a STARTTLS probe script: wait for a
+// line matching Expect (if set), optionally send Send, optionally read a
+// binary-framed reply via ReadFrame, and optionally upgrade the connection
+// to TLS in place.
+type ProbeStep struct {
+	Expect   string `yaml:"expect"`
+	Send     string `yaml:"send"`
+	STARTTLS bool   `yaml:"starttls"`
+
+	// ReadFrame selects a binary framing reader instead of the line-oriented
+	// Expect match, for protocols whose replies have no guaranteed newline:
+	// "bytes" reads exactly ReadBytes raw bytes, "ber" reads one BER/DER TLV
+	// (as LDAP's ExtendedResponse uses), and "mysql" reads one
+	// length-prefixed MySQL protocol packet. ExpectBytes, if set, is the
+	// hex-encoded reply the frame must equal; if empty, the frame is read
+	// and discarded without comparison.
+	ReadFrame   string `yaml:"read_frame"`
+	ReadBytes   int    `yaml:"read_bytes"`
+	ExpectBytes string `yaml:"expect_bytes"`
+
+	// VerifyLDAPResult, only meaningful with ReadFrame "ber", parses the
+	// frame as an LDAP extendedResponse and fails the step unless its
+	// resultCode is success (0) — ExpectBytes can't do this because the
+	// server echoes our messageID but matchedDN/diagnosticMessage are
+	// variable-length, so the resultCode isn't at a fixed byte offset.
+	VerifyLDAPResult bool `yaml:"verify_ldap_result"`
+}
+
+// ProbeScript is an ordered list of steps that negotiate STARTTLS for one
+// protocol.
+type ProbeScript struct {
+	Name  string      `yaml:"name"`
+	Steps []ProbeStep `yaml:"steps"`
+}
+
+// builtinProbeScripts ship the STARTTLS negotiations this tool already
+// understood natively, now expressed as data instead of code, plus a
+// handful of additional protocols. Users can add more with -probe-script
+// without touching the binary.
+var builtinProbeScripts = map[string]ProbeScript{
+	"smtp": {
+		Name: "smtp",
+		Steps: []ProbeStep{
+			{Expect: `^220`},
+			{Send: "EHLO localhost\r\n", Expect: `^250 `},
+			{Send: "STARTTLS\r\n", Expect: `^220`, STARTTLS: true},
+		},
+	},
+	"imap": {
+		Name: "imap",
+		Steps: []ProbeStep{
+			{Expect: `^\* OK`},
+			{Send: "a001 STARTTLS\r\n", Expect: `^a001 OK`, STARTTLS: true},
+		},
+	},
+	"pop3": {
+		Name: "pop3",
+		Steps: []ProbeStep{
+			{Expect: `^\+OK`},
+			{Send: "STLS\r\n", Expect: `^\+OK`, STARTTLS: true},
+		},
+	},
+	"ftp": {
+		Name: "ftp",
+		Steps: []ProbeStep{
+			{Expect: `^220`},
+			{Send: "AUTH TLS\r\n", Expect: `^234`, STARTTLS: true},
+		},
+	},
+	"xmpp": {
+		Name: "xmpp",
+		Steps: []ProbeStep{
+			{Send: "<stream:stream xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' to='localhost' version='1.0'>\n", Expect: `<stream:features`},
+			{Send: "<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>", Expect: `<proceed`, STARTTLS: true},
+		},
+	},
+	"postgres": {
+		Name: "postgres",
+		Steps: []ProbeStep{
+			// SSLRequest: 4-byte length (8) + the SSLRequest code 80877103.
+			{Send: "\x00\x00\x00\x08\x04\xd2\x16\x2f", ReadFrame: "bytes", ReadBytes: 1, ExpectBytes: "53", STARTTLS: true}, // 0x53 = 'S' (willing)
+		},
+	},
+	"mysql": {
+		Name: "mysql",
+		Steps: []ProbeStep{
+			// The server speaks first with its initial handshake packet; we
+			// don't need its contents, only to consume it before replying.
+			{ReadFrame: "mysql"},
+			{Send: mysqlSSLRequestPacket(), STARTTLS: true},
+		},
+	},
+	"ldap": {
+		Name: "ldap",
+		Steps: []ProbeStep{
+			// StartTLS extendedRequest (RFC 4511 section 4.12): LDAPMessage{messageID=1,
+			// extendedRequest{requestName="1.3.6.1.4.1.1466.20037"}}, BER-encoded.
+			{Send: "\x30\x1d\x02\x01\x01\x77\x18\x80\x161.3.6.1.4.1.1466.20037", ReadFrame: "ber", VerifyLDAPResult: true, STARTTLS: true},
+		},
+	},
+}
+
+// mysqlSSLRequestPacket builds the SSLRequest packet a MySQL client sends in
+// place of a full handshake response when it wants to upgrade to TLS before
+// authenticating: a standard packet header (3-byte little-endian payload
+// length, 1-byte sequence id) wrapping the first part of the protocol::41
+// handshake response payload with CLIENT_SSL set, and nothing past that —
+// the server begins the TLS handshake as soon as it sees CLIENT_SSL.
+func mysqlSSLRequestPacket() string {
+	const (
+		clientProtocol41 = 0x00000200
+		clientSSL        = 0x00000800
+	)
+
+	payload := make([]byte, 32)
+	binary.LittleEndian.PutUint32(payload[0:4], clientProtocol41|clientSSL)
+	binary.LittleEndian.PutUint32(payload[4:8], 0x40000000) // max packet size
+	payload[8] = 0x21                                       // utf8_general_ci
+	// payload[9:32] is reserved and stays zero.
+
+	header := []byte{
+		byte(len(payload)),
+		byte(len(payload) >> 8),
+		byte(len(payload) >> 16),
+		1, // sequence id: the server's handshake was packet 0
+	}
+	return string(append(header, payload...))
+}
+
+// loadProbeScript returns the probe script for protocol, preferring a
+// user-supplied -probe-script file (which may override or add protocols)
+// over the built-ins.
+func loadProbeScript(protocol, probeScriptPath string) (ProbeScript, error) {
+	if probeScriptPath != "" {
+		data, err := os.ReadFile(probeScriptPath)
+		if err != nil {
+			return ProbeScript{}, fmt.Errorf("failed to read probe script: %v", err)
+		}
+
+		var scripts map[string]ProbeScript
+		if err := yaml.Unmarshal(data, &scripts); err != nil {
+			return ProbeScript{}, fmt.Errorf("failed to parse probe script: %v", err)
+		}
+
+		if script, ok := scripts[protocol]; ok {
+			return script, nil
+		}
+	}
+
+	script, ok := builtinProbeScripts[protocol]
+	if !ok {
+		return ProbeScript{}, fmt.Errorf("no probe script for protocol: %s", protocol)
+	}
+	return script, nil
+}
+
+// runProbeScript executes script against conn using r for buffered,
+// line-oriented reads, returning once a STARTTLS step completes
+// successfully so the caller can upgrade the connection.
+func runProbeScript(conn net.Conn, r *bufio.Reader, script ProbeScript, timeout time.Duration) error {
+	for _, step := range script.Steps {
+		if step.Send != "" {
+			conn.SetWriteDeadline(time.Now().Add(timeout))
+			if _, err := conn.Write([]byte(step.Send)); err != nil {
+				return fmt.Errorf("%s: failed to send %q: %v", script.Name, step.Send, err)
+			}
+		}
+
+		if step.Expect != "" {
+			if err := readUntilMatch(r, step.Expect, timeout); err != nil {
+				return fmt.Errorf("%s: %v", script.Name, err)
+			}
+		}
+
+		if step.ReadFrame != "" {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+			frame, err := readFrame(r, step)
+			if err != nil {
+				return fmt.Errorf("%s: failed to read %s frame: %v", script.Name, step.ReadFrame, err)
+			}
+			if step.ExpectBytes != "" {
+				want, err := hex.DecodeString(step.ExpectBytes)
+				if err != nil {
+					return fmt.Errorf("%s: invalid expect_bytes %q: %v", script.Name, step.ExpectBytes, err)
+				}
+				if !bytes.Equal(frame, want) {
+					return fmt.Errorf("%s: unexpected reply % x, want % x", script.Name, frame, want)
+				}
+			}
+			if step.VerifyLDAPResult {
+				ok, err := ldapExtendedResponseOK(frame)
+				if err != nil {
+					return fmt.Errorf("%s: failed to parse LDAP extendedResponse: %v", script.Name, err)
+				}
+				if !ok {
+					return fmt.Errorf("%s: server returned a non-success LDAP resultCode", script.Name)
+				}
+			}
+		}
+
+		if step.STARTTLS {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s: probe script has no starttls step", script.Name)
+}
+
+// readUntilMatch reads lines from r until one matches pattern, mirroring
+// protocols (like SMTP's multi-line EHLO reply) where the response we care
+// about may be preceded by other lines.
+func readUntilMatch(r *bufio.Reader, pattern string, timeout time.Duration) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid expect pattern %q: %v", pattern, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %q", pattern)
+		}
+
+		line, err := r.ReadString('\n')
+		if line == "" && err != nil {
+			return fmt.Errorf("failed to read response: %v", err)
+		}
+
+		if re.MatchString(strings.TrimRight(line, "\r\n")) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read response: %v", err)
+		}
+	}
+}
+
+// readFrame reads one binary-framed reply from r according to step's
+// ReadFrame kind, returning the whole frame (header included) so callers
+// can compare it against ExpectBytes.
+func readFrame(r *bufio.Reader, step ProbeStep) ([]byte, error) {
+	switch step.ReadFrame {
+	case "bytes":
+		buf := make([]byte, step.ReadBytes)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	case "ber":
+		return readBERFrame(r)
+	case "mysql":
+		return readMySQLPacket(r)
+	default:
+		return nil, fmt.Errorf("unknown read_frame kind %q", step.ReadFrame)
+	}
+}
+
+// maxBERFrameLength bounds the content length readBERFrame will allocate
+// for. An LDAP StartTLS extendedResponse is a few dozen bytes; without a
+// cap, a malicious or broken server could put an attacker-controlled
+// multi-gigabyte length in the long-form length octets and force a huge
+// allocation per probe.
+const maxBERFrameLength = 64 * 1024
+
+// readBERFrame reads one complete BER/DER TLV (tag, length octets, and
+// content) from r, the framing LDAP messages use in place of a
+// newline-delimited reply. Only the short and long definite-length forms
+// (ITU-T X.690 section 8.1.3) are supported; indefinite length is not used by LDAP.
+func readBERFrame(r *bufio.Reader) ([]byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	lengthByte, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var lengthOctets []byte
+	length := int(lengthByte)
+	if lengthByte&0x80 != 0 {
+		n := int(lengthByte &^ 0x80)
+		if n == 0 || n > 4 {
+			return nil, fmt.Errorf("unsupported BER length encoding (%d length octets)", n)
+		}
+		lengthOctets = make([]byte, n)
+		if _, err := io.ReadFull(r, lengthOctets); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range lengthOctets {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxBERFrameLength {
+		return nil, fmt.Errorf("BER frame content length %d exceeds the %d byte limit", length, maxBERFrameLength)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, 0, 2+len(lengthOctets)+length)
+	frame = append(frame, tag, lengthByte)
+	frame = append(frame, lengthOctets...)
+	frame = append(frame, content...)
+	return frame, nil
+}
+
+// parseBERTLV splits one BER TLV off the front of data, returning its tag,
+// content, and the remaining bytes after it.
+func parseBERTLV(data []byte) (tag byte, content, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, fmt.Errorf("truncated BER TLV")
+	}
+	tag = data[0]
+	lengthByte := data[1]
+	data = data[2:]
+
+	length := int(lengthByte)
+	if lengthByte&0x80 != 0 {
+		n := int(lengthByte &^ 0x80)
+		if n == 0 || n > 4 || len(data) < n {
+			return 0, nil, nil, fmt.Errorf("unsupported BER length encoding")
+		}
+		length = 0
+		for _, b := range data[:n] {
+			length = length<<8 | int(b)
+		}
+		data = data[n:]
+	}
+	if len(data) < length {
+		return 0, nil, nil, fmt.Errorf("truncated BER content")
+	}
+	return tag, data[:length], data[length:], nil
+}
+
+// ldapExtendedResponseOK parses frame as an LDAPMessage wrapping an
+// extendedResponse (as returned for the ldap built-in's StartTLS request)
+// and reports whether its resultCode is success (0).
+func ldapExtendedResponseOK(frame []byte) (bool, error) {
+	_, seqContent, _, err := parseBERTLV(frame)
+	if err != nil {
+		return false, fmt.Errorf("not a BER SEQUENCE: %v", err)
+	}
+	_, _, rest, err := parseBERTLV(seqContent) // messageID
+	if err != nil {
+		return false, fmt.Errorf("missing messageID: %v", err)
+	}
+	_, extContent, _, err := parseBERTLV(rest) // extendedResponse
+	if err != nil {
+		return false, fmt.Errorf("missing extendedResponse: %v", err)
+	}
+	_, resultCode, _, err := parseBERTLV(extContent) // resultCode ENUMERATED
+	if err != nil {
+		return false, fmt.Errorf("missing resultCode: %v", err)
+	}
+	if len(resultCode) != 1 {
+		return false, fmt.Errorf("unexpected resultCode encoding: % x", resultCode)
+	}
+	return resultCode[0] == 0, nil
+}
+
+// readMySQLPacket reads one length-prefixed MySQL protocol packet: a 4-byte
+// header (3-byte little-endian payload length, 1-byte sequence id) followed
+// by that many payload bytes.
+func readMySQLPacket(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	return append(header, payload...), nil
+}
+
+// getTLSCertificatesWithSTARTTLS connects to server:port, negotiates
+// STARTTLS using the probe script for protocol (the built-in script, or
+// one loaded from config.ProbeScriptPath), and returns the resulting peer
+// certificate chain.
+func getTLSCertificatesWithSTARTTLS(server string, port int, protocol string, config Config) ([]*x509.Certificate, error) {
+	script, err := loadProbeScript(protocol, config.ProbeScriptPath)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", server, port), config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(config.Timeout))
+
+	if err := runProbeScript(conn, r, script, config.Timeout); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := buildTLSConfig(server, config)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("TLS handshake failed: %v", err)
+	}
+
+	state := tlsConn.ConnectionState()
+	return state.PeerCertificates, nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeServer drives the server side of a net.Pipe for a built-in probe
+// script: read whatever the client sends for each step and write back the
+// step's expected reply, so runProbeScript's send-then-expect ordering can
+// be exercised without a real network connection.
+func fakeServer(t *testing.T, conn net.Conn, script ProbeScript, replies map[string]string) {
+	t.Helper()
+
+	r := bufio.NewReader(conn)
+	for _, step := range script.Steps {
+		if step.Send != "" {
+			if err := readLine(r, step.Send); err != nil {
+				t.Errorf("server: %v", err)
+				return
+			}
+		}
+		if reply, ok := replies[step.Send]; ok {
+			if _, err := conn.Write([]byte(reply)); err != nil {
+				t.Errorf("server: failed to write reply: %v", err)
+				return
+			}
+		}
+	}
+}
+
+func readLine(r *bufio.Reader, want string) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if line != want {
+		return &lineMismatchError{want: want, got: line}
+	}
+	return nil
+}
+
+type lineMismatchError struct {
+	want, got string
+}
+
+func (e *lineMismatchError) Error() string {
+	return "expected client to send " + e.want + ", got " + e.got
+}
+
+func TestRunProbeScriptSendsBeforeExpecting(t *testing.T) {
+	script := builtinProbeScripts["imap"]
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serverConn.Write([]byte("* OK IMAP4rev1 ready\r\n"))
+		fakeServer(t, serverConn, script, map[string]string{
+			"a001 STARTTLS\r\n": "a001 OK Begin TLS negotiation now\r\n",
+		})
+	}()
+
+	r := bufio.NewReader(clientConn)
+	err := runProbeScript(clientConn, r, script, 2*time.Second)
+	<-done
+
+	if err != nil {
+		t.Fatalf("runProbeScript returned error: %v", err)
+	}
+}
+
+func TestRunProbeScriptPostgresSSLRequest(t *testing.T) {
+	script := builtinProbeScripts["postgres"]
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		buf := make([]byte, 8)
+		io.ReadFull(serverConn, buf)
+		serverConn.Write([]byte{'S'})
+	}()
+
+	r := bufio.NewReader(clientConn)
+	if err := runProbeScript(clientConn, r, script, 2*time.Second); err != nil {
+		t.Fatalf("runProbeScript returned error: %v", err)
+	}
+}
+
+func TestRunProbeScriptPostgresRejectsUnwilling(t *testing.T) {
+	script := builtinProbeScripts["postgres"]
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		buf := make([]byte, 8)
+		io.ReadFull(serverConn, buf)
+		serverConn.Write([]byte{'N'})
+	}()
+
+	clientConn.SetDeadline(time.Now().Add(500 * time.Millisecond))
+	r := bufio.NewReader(clientConn)
+	if err := runProbeScript(clientConn, r, script, 500*time.Millisecond); err == nil {
+		t.Fatal("expected an error when the server refuses SSLRequest")
+	}
+}
+
+func TestRunProbeScriptMySQLSSLRequest(t *testing.T) {
+	script := builtinProbeScripts["mysql"]
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Fake initial handshake packet: 2-byte payload, sequence id 0.
+		serverConn.Write([]byte{2, 0, 0, 0, 0x0a, 0x00})
+
+		header := make([]byte, 4)
+		io.ReadFull(serverConn, header)
+		length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+		payload := make([]byte, length)
+		io.ReadFull(serverConn, payload)
+		if length != 32 || payload[1]&0x08 == 0 {
+			t.Errorf("server: SSLRequest payload missing CLIENT_SSL: % x", payload)
+		}
+	}()
+
+	r := bufio.NewReader(clientConn)
+	err := runProbeScript(clientConn, r, script, 2*time.Second)
+	<-done
+
+	if err != nil {
+		t.Fatalf("runProbeScript returned error: %v", err)
+	}
+}
+
+func TestRunProbeScriptLDAPStartTLS(t *testing.T) {
+	script := builtinProbeScripts["ldap"]
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		r := bufio.NewReader(serverConn)
+		readBERFrame(r) // consume the StartTLS extendedRequest
+		// extendedResponse{messageID=1, resultCode=success(0)}, BER-encoded.
+		serverConn.Write([]byte("\x30\x0c\x02\x01\x01\x78\x07\x0a\x01\x00\x04\x00\x04\x00"))
+	}()
+
+	r := bufio.NewReader(clientConn)
+	if err := runProbeScript(clientConn, r, script, 2*time.Second); err != nil {
+		t.Fatalf("runProbeScript returned error: %v", err)
+	}
+}
+
+func TestRunProbeScriptLDAPRejectsNonSuccessResult(t *testing.T) {
+	script := builtinProbeScripts["ldap"]
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		r := bufio.NewReader(serverConn)
+		readBERFrame(r) // consume the StartTLS extendedRequest
+		// extendedResponse{messageID=1, resultCode=protocolError(2)}.
+		serverConn.Write([]byte("\x30\x0c\x02\x01\x01\x78\x07\x0a\x01\x02\x04\x00\x04\x00"))
+	}()
+
+	clientConn.SetDeadline(time.Now().Add(500 * time.Millisecond))
+	r := bufio.NewReader(clientConn)
+	if err := runProbeScript(clientConn, r, script, 500*time.Millisecond); err == nil {
+		t.Fatal("expected an error for a non-success LDAP resultCode")
+	}
+}
+
+func TestReadBERFrameRejectsOversizedLength(t *testing.T) {
+	// tag 0x04, long-form length claiming far more content than we'll
+	// actually supply: must fail before attempting to allocate/read it.
+	var buf bytes.Buffer
+	buf.WriteByte(0x04)
+	buf.WriteByte(0x84) // 4 length octets follow
+	buf.Write([]byte{0x7f, 0xff, 0xff, 0xff})
+
+	if _, err := readBERFrame(bufio.NewReader(&buf)); err == nil {
+		t.Fatal("expected an error for a BER length over the size cap")
+	}
+}
+
+func TestReadBERFrameLongForm(t *testing.T) {
+	// tag 0x04 (OCTET STRING), long-form length (0x81 0xc8 = 200 bytes).
+	var buf bytes.Buffer
+	buf.WriteByte(0x04)
+	buf.WriteByte(0x81)
+	buf.WriteByte(0xc8)
+	content := bytes.Repeat([]byte("x"), 200)
+	buf.Write(content)
+
+	frame, err := readBERFrame(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("readBERFrame returned error: %v", err)
+	}
+	if !bytes.Equal(frame[3:], content) {
+		t.Fatalf("frame content mismatch: got %d bytes, want %d", len(frame)-3, len(content))
+	}
+}
+
+func TestRunProbeScriptFailsOnUnexpectedReply(t *testing.T) {
+	script := builtinProbeScripts["pop3"]
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		serverConn.Write([]byte("+OK POP3 ready\r\n"))
+		io := bufio.NewReader(serverConn)
+		io.ReadString('\n') // consume "STLS\r\n"
+		serverConn.Write([]byte("-ERR not supported\r\n"))
+	}()
+
+	clientConn.SetDeadline(time.Now().Add(500 * time.Millisecond))
+	r := bufio.NewReader(clientConn)
+	if err := runProbeScript(clientConn, r, script, 500*time.Millisecond); err == nil {
+		t.Fatal("expected an error for an unexpected reply, got nil")
+	}
+}
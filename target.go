@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Target describes a parsed command-line target: either a network endpoint
+// reachable over some protocol, or a local path for the file/pkcs12
+// providers.
+type Target struct {
+	Scheme string // https, tls, smtp, imap, pop3, ftp, xmpp, ldap, mysql, postgres, file, pkcs12
+	Server string // hostname, empty for local providers
+	Port   int    // zero for local providers
+	Path   string // local filesystem path, only set for file/pkcs12
+}
+
+// parseTarget splits a target string into a Target. Network targets accept
+// "server", "server:port" or "protocol://server[:port]". The file and
+// pkcs12 schemes instead take "file:///path/to/bundle.pem" or
+// "pkcs12:///path/to/store.p12", where everything after "://" is a
+// filesystem path rather than a host.
+func parseTarget(target string) (Target, error) {
+	t := Target{
+		Port:   443,
+		Scheme: "https",
+	}
+
+	if strings.Contains(target, "://") {
+		parts := strings.SplitN(target, "://", 2)
+		t.Scheme = strings.ToLower(parts[0])
+		rest := parts[1]
+
+		switch t.Scheme {
+		case "file", "pkcs12":
+			t.Path = rest
+			return t, nil
+		}
+
+		// Remove path if present
+		if idx := strings.Index(rest, "/"); idx != -1 {
+			rest = rest[:idx]
+		}
+
+		if strings.Contains(rest, ":") {
+			host, portStr, err := net.SplitHostPort(rest)
+			if err != nil {
+				return Target{}, err
+			}
+			t.Server = host
+			port, err := strconv.Atoi(portStr)
+			if err != nil {
+				return Target{}, fmt.Errorf("invalid port: %s", portStr)
+			}
+			t.Port = port
+		} else {
+			t.Server = rest
+			t.Port = defaultPort(t.Scheme)
+		}
+
+		return t, nil
+	}
+
+	if strings.Contains(target, ":") {
+		host, portStr, err := net.SplitHostPort(target)
+		if err != nil {
+			return Target{}, err
+		}
+		t.Server = host
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid port: %s", portStr)
+		}
+		t.Port = port
+		return t, nil
+	}
+
+	t.Server = target
+	return t, nil
+}
+
+// defaultPort returns the conventional STARTTLS/TLS port for a scheme.
+func defaultPort(scheme string) int {
+	switch scheme {
+	case "https", "tls":
+		return 443
+	case "smtp":
+		return 587 // STARTTLS port
+	case "imap":
+		return 143 // STARTTLS port
+	case "pop3":
+		return 110 // STARTTLS port
+	case "ftp":
+		return 21 // STARTTLS port
+	case "xmpp":
+		return 5222 // STARTTLS port
+	case "ldap":
+		return 389 // STARTTLS port
+	case "mysql":
+		return 3306 // SSLRequest port
+	case "postgres":
+		return 5432 // SSLRequest port
+	default:
+		return 443
+	}
+}
+
+// bundleName returns the base name used for bundle/output files for this
+// target, e.g. "example.com" or the stem of a local file path.
+func (t Target) bundleName() string {
+	if t.Server != "" {
+		return t.Server
+	}
+
+	path := strings.TrimSuffix(t.Path, "/")
+	if idx := strings.LastIndex(path, "/"); idx != -1 {
+		path = path[idx+1:]
+	}
+	if idx := strings.LastIndex(path, "."); idx != -1 {
+		path = path[:idx]
+	}
+	if path == "" {
+		return "bundle"
+	}
+	return path
+}
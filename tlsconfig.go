@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// buildTLSConfig assembles a *tls.Config from the Config flags that
+// control the handshake: client certificate, trusted root pool, version
+// bounds, cipher suite restriction, SNI override and ALPN protocols. Every
+// provider that opens a TLS connection goes through this so that
+// -client-cert/-ca-file/etc. apply uniformly regardless of scheme.
+func buildTLSConfig(server string, config Config) (*tls.Config, error) {
+	serverName := server
+	if config.ServerName != "" {
+		serverName = config.ServerName
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSSL,
+		ServerName:         serverName,
+	}
+
+	if config.ClientCertFile != "" || config.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client keypair: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read -ca-file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in -ca-file %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.MinTLSVersion != "" {
+		v, err := parseTLSVersion(config.MinTLSVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -min-tls: %v", err)
+		}
+		tlsConfig.MinVersion = v
+	}
+
+	if config.MaxTLSVersion != "" {
+		v, err := parseTLSVersion(config.MaxTLSVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -max-tls: %v", err)
+		}
+		tlsConfig.MaxVersion = v
+	}
+
+	if config.CipherSuites != "" {
+		suites, err := parseCipherSuites(config.CipherSuites)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -cipher-suites: %v", err)
+		}
+		tlsConfig.CipherSuites = suites
+	}
+
+	if config.ALPN != "" {
+		tlsConfig.NextProtos = strings.Split(config.ALPN, ",")
+	}
+
+	return tlsConfig, nil
+}
+
+var tlsVersionsByName = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func parseTLSVersion(name string) (uint16, error) {
+	v, ok := tlsVersionsByName[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q (want one of 1.0, 1.1, 1.2, 1.3)", name)
+	}
+	return v, nil
+}
+
+func parseCipherSuites(csv string) ([]uint16, error) {
+	byName := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		byName[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		byName[suite.Name] = suite.ID
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(csv, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
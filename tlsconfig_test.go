@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseTLSVersionUnknown(t *testing.T) {
+	if _, err := parseTLSVersion("1.4"); err == nil {
+		t.Fatal("expected an error for an unknown TLS version name")
+	}
+}
+
+func TestParseTLSVersionKnown(t *testing.T) {
+	v, err := parseTLSVersion("1.2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != tls.VersionTLS12 {
+		t.Fatalf("got %#x, want VersionTLS12 (%#x)", v, tls.VersionTLS12)
+	}
+}
+
+func TestParseCipherSuitesUnknown(t *testing.T) {
+	if _, err := parseCipherSuites("NOT_A_REAL_CIPHER_SUITE"); err == nil {
+		t.Fatal("expected an error for an unknown cipher suite name")
+	}
+}
+
+func TestParseCipherSuitesKnown(t *testing.T) {
+	name := tls.CipherSuiteName(tls.TLS_AES_128_GCM_SHA256)
+	ids, err := parseCipherSuites(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != tls.TLS_AES_128_GCM_SHA256 {
+		t.Fatalf("got %v, want [%#x]", ids, tls.TLS_AES_128_GCM_SHA256)
+	}
+}
+
+// writePEMKeyPair generates a self-signed cert/key pair and writes both to
+// dir, returning their paths.
+func writePEMKeyPair(t *testing.T, dir string) (certPath, keyPath string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create cert: %v", err)
+	}
+
+	certPath = filepath.Join(dir, "client.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	keyPath = filepath.Join(dir, "client.key")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	return certPath, keyPath
+}
+
+func TestBuildTLSConfigLoadsClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writePEMKeyPair(t, dir)
+
+	config := Config{ClientCertFile: certPath, ClientKeyFile: keyPath}
+	tlsConfig, err := buildTLSConfig("example.com", config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tlsConfig.Certificates) != 1 {
+		t.Fatalf("got %d certificates, want 1", len(tlsConfig.Certificates))
+	}
+}
+
+func TestBuildTLSConfigLoadsCAFile(t *testing.T) {
+	dir := t.TempDir()
+	certPath, _ := writePEMKeyPair(t, dir)
+	caPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatalf("read cert: %v", err)
+	}
+
+	config := Config{CAFile: certPath}
+	tlsConfig, err := buildTLSConfig("example.com", config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tlsConfig.RootCAs == nil {
+		t.Fatal("expected RootCAs to be populated")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		t.Fatal("failed to build reference pool")
+	}
+	if !tlsConfig.RootCAs.Equal(pool) {
+		t.Fatal("RootCAs does not match the -ca-file contents")
+	}
+}
+
+func TestBuildTLSConfigRejectsUnknownMinTLS(t *testing.T) {
+	config := Config{MinTLSVersion: "0.9"}
+	if _, err := buildTLSConfig("example.com", config); err == nil {
+		t.Fatal("expected an error for an invalid -min-tls value")
+	}
+}
+
+func TestBuildTLSConfigServerNameOverride(t *testing.T) {
+	config := Config{ServerName: "override.example.com"}
+	tlsConfig, err := buildTLSConfig("example.com", config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tlsConfig.ServerName != "override.example.com" {
+		t.Fatalf("ServerName = %q, want override.example.com", tlsConfig.ServerName)
+	}
+}